@@ -0,0 +1,297 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ref 是一个插件制品引用，形如 "registry.example.com/plugins/xxim-webhook:v1"
+type ref struct {
+	Registry string
+	Name     string
+	Tag      string
+}
+
+// parseRef 解析 "[registry/]name[:tag]" 形式的插件引用，默认registry取 opts.Registry，默认tag为"latest"
+func (s *Server) parseRef(r string) (ref, error) {
+	if r == "" {
+		return ref{}, fmt.Errorf("plugin: empty ref")
+	}
+
+	registry := s.opts.Registry
+	rest := r
+	if slash := strings.Index(r, "/"); slash != -1 && strings.Contains(r[:slash], ".") {
+		registry = r[:slash]
+		rest = r[slash+1:]
+	}
+
+	name, tag := rest, "latest"
+	if idx := strings.LastIndex(rest, ":"); idx != -1 {
+		name, tag = rest[:idx], rest[idx+1:]
+	}
+	if name == "" {
+		return ref{}, fmt.Errorf("plugin: invalid ref %q", r)
+	}
+	return ref{Registry: registry, Name: name, Tag: tag}, nil
+}
+
+// Pull 从OCI镜像仓库拉取插件制品，校验其摘要后写入本地内容寻址存储，
+// 但不会安装（即不会在 store/plugins 下创建引用），安装需显式调用 Install。
+func (s *Server) Pull(refStr string) (*manifest, error) {
+	r, err := s.parseRef(refStr)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestDigest, manifestData, err := s.ociGetManifest(r)
+	if err != nil {
+		return nil, fmt.Errorf("plugin: pull manifest failed: %w", err)
+	}
+	if _, err := s.store.putBlob(bytes.NewReader(manifestData), manifestDigest); err != nil {
+		return nil, fmt.Errorf("plugin: verify manifest failed: %w", err)
+	}
+
+	m, err := s.store.getManifest(manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	// 拉取可执行文件层blob，按manifest中声明的摘要校验
+	execBody, err := s.ociGetBlob(r, m.ExecDigest)
+	if err != nil {
+		return nil, fmt.Errorf("plugin: pull executable layer failed: %w", err)
+	}
+	defer execBody.Close()
+	if _, err := s.store.putBlob(execBody, m.ExecDigest); err != nil {
+		return nil, fmt.Errorf("plugin: verify executable layer failed: %w", err)
+	}
+
+	s.Info("plugin pulled", zap.String("ref", refStr), zap.String("manifest", manifestDigest))
+	return m, nil
+}
+
+// Push 将本地已安装的插件制品连同其依赖blob推送到OCI镜像仓库
+func (s *Server) Push(refStr string) error {
+	r, err := s.parseRef(refStr)
+	if err != nil {
+		return err
+	}
+
+	digest, err := s.store.getRef(r.Name, r.Tag)
+	if err != nil {
+		return fmt.Errorf("plugin: ref %q not installed locally: %w", refStr, err)
+	}
+	m, err := s.store.getManifest(digest)
+	if err != nil {
+		return err
+	}
+
+	execFile, err := s.store.openBlob(m.ExecDigest)
+	if err != nil {
+		return err
+	}
+	defer execFile.Close()
+
+	if err := s.ociPutBlob(r, m.ExecDigest, execFile); err != nil {
+		return fmt.Errorf("plugin: push executable layer failed: %w", err)
+	}
+	if err := s.ociPutManifest(r, m); err != nil {
+		return fmt.Errorf("plugin: push manifest failed: %w", err)
+	}
+
+	s.Info("plugin pushed", zap.String("ref", refStr))
+	return nil
+}
+
+// Install 将一个已拉取到本地存储的制品安装为本地可运行的插件。
+// alias 不为空时，以 alias 作为本地安装名，这样同一份内容可以安装成多个
+// 本地名字而不互相覆盖；为空时使用ref自身的name。
+//
+// granted 是用户确认授予该插件的权限，必须覆盖manifest里声明的全部需求，否则拒绝安装；
+// 授予结果记录在内存中（server重启后不保留，见 grantedPrivilegeStore），
+// startPluginApp 之后按这份记录决定给进程套上哪些能力。
+//
+// 注意：这里的"覆盖"只是准入检查，不代表每一项权限安装后都会被强制执行——
+// mount/network 目前只是告知插件被允许访问什么（见 pluginEnv），并不会真的
+// 做bind mount或出站过滤；resources 里也只有 mem 会被 applyResourceLimits
+// 真正套用，cpu 目前只校验授权、不限制。
+func (s *Server) Install(refStr string, alias string, granted []Privilege) error {
+	r, err := s.parseRef(refStr)
+	if err != nil {
+		return err
+	}
+
+	localName := r.Name
+	if alias != "" {
+		localName = alias
+	}
+
+	manifestDigest, err := s.store.getRef(r.Name, r.Tag)
+	if err != nil {
+		return fmt.Errorf("plugin: %q not pulled yet, run Pull first: %w", refStr, err)
+	}
+	m, err := s.store.getManifest(manifestDigest)
+	if err != nil {
+		return err
+	}
+
+	if err := checkGranted(privilegesFromManifest(m), granted); err != nil {
+		return fmt.Errorf("plugin: cannot install %q: %w", refStr, err)
+	}
+
+	if err := s.store.setRef(localName, r.Tag, manifestDigest); err != nil {
+		return err
+	}
+	// 把验证过摘要的exec层blob落成一个可以直接exec的文件，否则startPluginApp
+	// 找不到任何东西可以拉起 —— blobs/sha256下的内容是按摘要命名的，不能直接当成
+	// "./<name>"来跑。
+	if err := s.store.materializeExec(localName, m.ExecDigest); err != nil {
+		return fmt.Errorf("plugin: materialize executable for %q failed: %w", refStr, err)
+	}
+	s.privileges.set(localName, granted)
+
+	s.Info("plugin installed", zap.String("ref", refStr), zap.String("as", localName))
+	return nil
+}
+
+// Remove 卸载一个本地安装的插件引用，并停止其正在运行的实例。已拉取的blob不会被删除，
+// 因为同一块内容可能被其他 name/tag 引用。
+func (s *Server) Remove(name, tag string) error {
+	if tag == "" {
+		tag = "latest"
+	}
+	if err := s.stopPluginApp(name); err != nil {
+		s.Error("stop plugin before remove failed", zap.Error(err), zap.String("plugin", name))
+	}
+	if err := s.store.removeRef(name, tag); err != nil {
+		return err
+	}
+	s.privileges.clear(name)
+	s.Info("plugin removed", zap.String("plugin", name), zap.String("tag", tag))
+	return nil
+}
+
+// --- OCI registry client：只实现Distribution Spec中Pull/Push流程需要的最小子集 ---
+
+func (s *Server) registryBaseURL(r ref) string {
+	return fmt.Sprintf("https://%s/v2/%s", r.Registry, r.Name)
+}
+
+func (s *Server) ociGetManifest(r ref) (digest string, data []byte, err error) {
+	url := fmt.Sprintf("%s/manifests/%s", s.registryBaseURL(r), r.Tag)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("registry returned %s for %s", resp.Status, url)
+	}
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	rawDigest := resp.Header.Get("Docker-Content-Digest")
+	if rawDigest == "" {
+		return "", nil, fmt.Errorf("registry response for %s is missing Docker-Content-Digest, refusing to trust an unverifiable manifest", url)
+	}
+	digest = strings.TrimPrefix(rawDigest, "sha256:")
+	return digest, data, nil
+}
+
+func (s *Server) ociGetBlob(r ref, digest string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/blobs/sha256:%s", s.registryBaseURL(r), digest)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("registry returned %s for %s", resp.Status, url)
+	}
+	return resp.Body, nil
+}
+
+func (s *Server) ociPutBlob(r ref, digest string, body io.Reader) error {
+	url := fmt.Sprintf("%s/blobs/uploads/?digest=sha256:%s", s.registryBaseURL(r), digest)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("registry returned %s for %s", resp.Status, url)
+	}
+	return nil
+}
+
+func (s *Server) ociPutManifest(r ref, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/manifests/%s", s.registryBaseURL(r), r.Tag)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("registry returned %s for %s", resp.Status, url)
+	}
+	return nil
+}
+
+// startPluginsFromStore 枚举已安装的store引用并逐个启动，取代原先直接扫描 opts.Dir 下
+// 任意可执行文件的方式，确保只有经过 Install 校验过摘要的插件才会被启动。
+func (s *Server) startPluginsFromStore() error {
+	refs, err := s.store.listInstalled()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range refs {
+		s.Info("plugin start", zap.String("plugin", r.Name), zap.String("tag", r.Tag))
+		if err := s.startPluginApp(r.Name); err != nil {
+			s.Error("start plugin error", zap.Error(err), zap.String("plugin", r.Name))
+			continue
+		}
+		s.pluginManager.setRunningDigest(r.Name, r.ManifestDigest)
+	}
+	return nil
+}
+
+// restartIfDigestChanged 只有当 name 对应的已安装引用摘要与当前运行实例不一致时才重启，
+// 取代原先单纯依赖fsnotify Write事件的方式 —— 后者在文件还没写完整时就可能触发重启。
+func (s *Server) restartIfDigestChanged(name, tag string) error {
+	digest, err := s.store.getRef(name, tag)
+	if err != nil {
+		return err
+	}
+
+	if s.pluginManager.runningDigest(name) == digest {
+		return nil
+	}
+
+	if err := s.restartPlugin(name); err != nil {
+		return err
+	}
+	s.pluginManager.setRunningDigest(name, digest)
+	return nil
+}
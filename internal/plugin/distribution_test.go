@@ -0,0 +1,63 @@
+package plugin
+
+import "testing"
+
+func TestParseRef(t *testing.T) {
+	s := &Server{opts: &Options{Registry: "registry.example.com"}}
+
+	tests := []struct {
+		name    string
+		in      string
+		want    ref
+		wantErr bool
+	}{
+		{
+			name: "name only uses default registry and tag",
+			in:   "xxim-webhook",
+			want: ref{Registry: "registry.example.com", Name: "xxim-webhook", Tag: "latest"},
+		},
+		{
+			name: "name with tag",
+			in:   "xxim-webhook:v1",
+			want: ref{Registry: "registry.example.com", Name: "xxim-webhook", Tag: "v1"},
+		},
+		{
+			name: "explicit registry with tag",
+			in:   "other.example.com/plugins/xxim-webhook:v1",
+			want: ref{Registry: "other.example.com", Name: "plugins/xxim-webhook", Tag: "v1"},
+		},
+		{
+			name: "leading path segment without a dot is not treated as a registry",
+			in:   "plugins/xxim-webhook:v1",
+			want: ref{Registry: "registry.example.com", Name: "plugins/xxim-webhook", Tag: "v1"},
+		},
+		{
+			name:    "empty ref",
+			in:      "",
+			wantErr: true,
+		},
+		{
+			name:    "empty name",
+			in:      "other.example.com/",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.parseRef(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRef(%q) expected error, got nil", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRef(%q) unexpected error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseRef(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
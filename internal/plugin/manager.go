@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/internal/types"
+)
+
+// pluginInstance 代表一个已知的插件实例（无论是通过握手协议注册，还是WuKongIM本地拉起），
+// 实现 types.Plugin。
+type pluginInstance struct {
+	no      string // 插件编号，握手注册场景下与name相同
+	name    string
+	version string
+	addr    string // 插件对外提供服务的socket地址
+	methods map[types.PluginMethod]struct{}
+
+	mu     sync.RWMutex
+	status types.PluginStatus
+}
+
+func newPluginInstance(no, name, version, addr string, methods []types.PluginMethod) *pluginInstance {
+	methodSet := make(map[types.PluginMethod]struct{}, len(methods))
+	for _, m := range methods {
+		methodSet[m] = struct{}{}
+	}
+	return &pluginInstance{
+		no:      no,
+		name:    name,
+		version: version,
+		addr:    addr,
+		methods: methodSet,
+		status:  types.PluginStatusNormal,
+	}
+}
+
+// hasMethod 判断插件是否声明了支持某个方法，供 Server.Plugins 按方法筛选插件
+func (p *pluginInstance) hasMethod(m types.PluginMethod) bool {
+	_, ok := p.methods[m]
+	return ok
+}
+
+// Status 实现 types.Plugin
+func (p *pluginInstance) Status() types.PluginStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status
+}
+
+func (p *pluginInstance) setStatus(status types.PluginStatus) {
+	p.mu.Lock()
+	p.status = status
+	p.mu.Unlock()
+}
+
+// Stop 通知插件停止。对于本地拉起的插件，真正杀进程的逻辑在 supervisor 里；
+// 这里只负责把状态置为异常，防止它继续被 Plugins() 选中。
+func (p *pluginInstance) Stop(ctx context.Context) error {
+	p.setStatus(types.PluginStatusAbnormal)
+	return nil
+}
+
+// pluginManager 管理所有已知的插件实例
+type pluginManager struct {
+	mu      sync.RWMutex
+	plugins map[string]*pluginInstance // key: no
+	byName  map[string]*pluginInstance // key: name
+
+	runningDigests sync.Map // name -> 当前正在运行实例对应的摘要（sha256）：Install安装的插件为manifest摘要，watchPlugins直接发现的文件为文件内容摘要，供按摘要变化重启时比较
+
+	processesMu sync.Mutex
+	processes   map[string]*procState // name -> 本地exec拉起的插件进程状态，供supervisor做等待/重启/优雅停止
+}
+
+// procState 跟踪一个通过exec拉起的插件进程，供supervisor做等待、重启退避判断和优雅停止
+type procState struct {
+	cmd         *exec.Cmd
+	done        chan struct{} // cmd.Wait()返回后关闭，killProcessGroup据此判断进程是否已退出
+	retries     int           // 当前退避窗口内已经重启的次数
+	windowStart time.Time     // 当前退避窗口开始时间
+	manualStop  atomic.Bool   // Stop主动叫停，不再触发自动重启
+}
+
+func newProcState(cmd *exec.Cmd) *procState {
+	return &procState{cmd: cmd, done: make(chan struct{})}
+}
+
+func newPluginManager() *pluginManager {
+	return &pluginManager{
+		plugins:   make(map[string]*pluginInstance),
+		byName:    make(map[string]*pluginInstance),
+		processes: make(map[string]*procState),
+	}
+}
+
+func (m *pluginManager) setProcess(name string, st *procState) {
+	m.processesMu.Lock()
+	m.processes[name] = st
+	m.processesMu.Unlock()
+}
+
+func (m *pluginManager) getProcess(name string) *procState {
+	m.processesMu.Lock()
+	defer m.processesMu.Unlock()
+	return m.processes[name]
+}
+
+func (m *pluginManager) deleteProcess(name string) {
+	m.processesMu.Lock()
+	delete(m.processes, name)
+	m.processesMu.Unlock()
+}
+
+func (m *pluginManager) all() []*pluginInstance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	results := make([]*pluginInstance, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		results = append(results, p)
+	}
+	return results
+}
+
+func (m *pluginManager) get(no string) *pluginInstance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.plugins[no]
+}
+
+func (m *pluginManager) getByName(name string) []*pluginInstance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var results []*pluginInstance
+	for _, p := range m.plugins {
+		if p.name == name {
+			results = append(results, p)
+		}
+	}
+	return results
+}
+
+// registerFromInfo 将一次握手注册得到的插件信息登记进manager
+func (m *pluginManager) registerFromInfo(info *pluginInfo) {
+	p := newPluginInstance(info.Name, info.Name, info.Version, info.ServiceAddr, info.Methods)
+	m.mu.Lock()
+	m.plugins[p.no] = p
+	m.byName[p.name] = p
+	m.mu.Unlock()
+}
+
+// markAbnormal 把某个名字下所有已登记的插件实例状态置为异常，不再被 Plugins() 选中。
+// 用在本地拉起的插件退出且放弃重启时——这类插件没有走 handleDeregister 那条注销路径，
+// 但 Status() 也必须反映出它已经不可用了。
+func (m *pluginManager) markAbnormal(name string) {
+	for _, p := range m.getByName(name) {
+		p.setStatus(types.PluginStatusAbnormal)
+	}
+}
+
+// unregister 注销一个插件，经由 handleDeregister 调用：注册socket被删除，或非本地拉起的
+// 插件连续存活探测失败时。本地进程退出且放弃重启时走的是 markAbnormal，不是这里
+func (m *pluginManager) unregister(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for no, p := range m.plugins {
+		if p.name == name {
+			delete(m.plugins, no)
+		}
+	}
+	delete(m.byName, name)
+}
+
+// runningDigest 返回 name 当前运行实例记录的摘要（见 runningDigests），没有记录返回空字符串
+func (m *pluginManager) runningDigest(name string) string {
+	v, ok := m.runningDigests.Load(name)
+	if !ok {
+		return ""
+	}
+	return v.(string)
+}
+
+func (m *pluginManager) setRunningDigest(name, digest string) {
+	m.runningDigests.Store(name, digest)
+}
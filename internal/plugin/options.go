@@ -0,0 +1,33 @@
+package plugin
+
+import "time"
+
+// Options 插件子系统的启动参数
+type Options struct {
+	// Dir 插件可执行文件所在目录，同时也是内容寻址存储（store）的落盘位置
+	Dir string
+	// Registry 拉取/推送插件制品时默认使用的OCI镜像仓库地址，ref中显式带了registry时以ref为准
+	Registry string
+
+	// StopTimeout 停止插件进程时，发送SIGTERM后等待其自行退出的最长时间，超时后SIGKILL整个进程组
+	StopTimeout time.Duration
+	// RestartMaxRetries 在RestartResetWindow时间窗口内允许自动重启的最大次数，超过后放弃重启
+	RestartMaxRetries int
+	// RestartResetWindow 重启计数的固定窗口，从窗口内第一次退出开始计时，超过该时长后的下一次退出把计数清零
+	RestartResetWindow time.Duration
+	// LivenessInterval 对已注册插件发起存活探测的间隔
+	LivenessInterval time.Duration
+	// LivenessMaxFailures 连续存活探测失败达到该次数视为插件崩溃，触发重启
+	LivenessMaxFailures int
+}
+
+// NewOptions 返回带有默认值的 Options
+func NewOptions() *Options {
+	return &Options{
+		StopTimeout:         5 * time.Second,
+		RestartMaxRetries:   5,
+		RestartResetWindow:  time.Minute,
+		LivenessInterval:    10 * time.Second,
+		LivenessMaxFailures: 3,
+	}
+}
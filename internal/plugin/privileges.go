@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Privilege 插件运行所需的一项能力授权。模型参考Docker plugin manager：
+// 插件在manifest里声明自己需要什么，用户在 Install 时显式确认授予哪些，
+// server只按被授予的生效，拒绝任何超出授权范围的请求。
+type Privilege struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Value       []string `json:"value"`
+}
+
+const (
+	// PrivilegeNetwork 允许访问的出站host
+	PrivilegeNetwork = "network"
+	// PrivilegeMount sandboxDir之外的额外挂载路径
+	PrivilegeMount = "mount"
+	// PrivilegeRPCMethod 可调用的WuKongIM RPC方法
+	PrivilegeRPCMethod = "rpc"
+	// PrivilegeResources CPU/内存限额
+	PrivilegeResources = "resources"
+)
+
+// Privileges 返回ref对应manifest声明所需要的权限列表，供安装前向用户展示确认。
+//
+// 展示出来的每一项权限代表manifest"想要"什么，但只有 resources(mem) 会被真正
+// 套用到进程上；rpc/mount/network 的授予只在 Install 和 startPluginApp 时做准入
+// 校验，运行期间不做调用级的拦截，mount/network 见 pluginEnv 的说明。
+func (s *Server) Privileges(refStr string) ([]Privilege, error) {
+	r, err := s.parseRef(refStr)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := s.store.getRef(r.Name, r.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("plugin: %q not pulled yet, run Pull first: %w", refStr, err)
+	}
+	m, err := s.store.getManifest(digest)
+	if err != nil {
+		return nil, err
+	}
+	return privilegesFromManifest(m), nil
+}
+
+// privilegesFromManifest 把manifest里声明式的能力需求转成 Privilege 列表
+func privilegesFromManifest(m *manifest) []Privilege {
+	var privileges []Privilege
+	if len(m.Config.NetworkHosts) > 0 {
+		privileges = append(privileges, Privilege{Name: PrivilegeNetwork, Description: "访问指定的出站host", Value: m.Config.NetworkHosts})
+	}
+	if len(m.Config.Mounts) > 0 {
+		privileges = append(privileges, Privilege{Name: PrivilegeMount, Description: "挂载sandboxDir之外的路径", Value: m.Config.Mounts})
+	}
+	if len(m.Config.RPCMethods) > 0 {
+		privileges = append(privileges, Privilege{Name: PrivilegeRPCMethod, Description: "调用WuKongIM的RPC方法", Value: m.Config.RPCMethods})
+	}
+	var resourceValues []string
+	if m.Config.Resources.CPU != "" {
+		resourceValues = append(resourceValues, "cpu="+m.Config.Resources.CPU)
+	}
+	if m.Config.Resources.Memory != "" {
+		resourceValues = append(resourceValues, "mem="+m.Config.Resources.Memory)
+	}
+	if len(resourceValues) > 0 {
+		privileges = append(privileges, Privilege{Name: PrivilegeResources, Description: "CPU/内存限额", Value: resourceValues})
+	}
+	return privileges
+}
+
+// checkGranted 校验required中声明的每一项权限值是否都被granted覆盖，
+// 任何一项超出授权范围都拒绝 —— 这样随便丢进目录的二进制不再天然拥有server的全部权限。
+func checkGranted(required, granted []Privilege) error {
+	grantedValues := make(map[string]map[string]struct{}, len(granted))
+	for _, g := range granted {
+		values := grantedValues[g.Name]
+		if values == nil {
+			values = make(map[string]struct{}, len(g.Value))
+			grantedValues[g.Name] = values
+		}
+		for _, v := range g.Value {
+			values[v] = struct{}{}
+		}
+	}
+
+	for _, req := range required {
+		values, ok := grantedValues[req.Name]
+		if !ok {
+			return fmt.Errorf("plugin: privilege %q was not granted", req.Name)
+		}
+		for _, v := range req.Value {
+			if _, ok := values[v]; !ok {
+				return fmt.Errorf("plugin: privilege %q value %q was not granted", req.Name, v)
+			}
+		}
+	}
+	return nil
+}
+
+// grantedPrivilegeStore 记录每个本地插件名在 Install 时被授予的权限，
+// startPluginApp 据此决定把哪些能力真正加到进程上。
+// 记录只保存在内存中，不写盘：server重启后记录为空，声明了任何权限的插件
+// 在 startPluginApp 的 checkGranted 处会被拒绝启动，直到再次 Install。
+type grantedPrivilegeStore struct {
+	mu     sync.RWMutex
+	byName map[string][]Privilege
+}
+
+func newGrantedPrivilegeStore() *grantedPrivilegeStore {
+	return &grantedPrivilegeStore{byName: make(map[string][]Privilege)}
+}
+
+func (g *grantedPrivilegeStore) set(name string, privileges []Privilege) {
+	g.mu.Lock()
+	g.byName[name] = privileges
+	g.mu.Unlock()
+}
+
+func (g *grantedPrivilegeStore) get(name string) []Privilege {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.byName[name]
+}
+
+func (g *grantedPrivilegeStore) clear(name string) {
+	g.mu.Lock()
+	delete(g.byName, name)
+	g.mu.Unlock()
+}
+
+func grantedValue(granted []Privilege, name string) []string {
+	for _, g := range granted {
+		if g.Name == name {
+			return g.Value
+		}
+	}
+	return nil
+}
+
+// pluginEnv 把已授予的权限和manifest声明的环境变量渲染成插件进程的环境变量。
+//
+// 注意：mount/network两项权限目前只是告知性的——插件进程仍然拥有和server
+// 一样的文件系统可见性和出站网络访问，这里既不会bind mount限制可见目录，
+// 也不会过滤出站流量，只是把"被允许访问什么"写进环境变量供插件自律遵守。
+// 真正的隔离（namespace、bind mount、iptables/eBPF过滤）需要留给容器化部署，
+// 在此之前不要把mount/network的授权当成安全边界。
+func pluginEnv(m *manifest, granted []Privilege) []string {
+	env := make([]string, 0, len(m.Config.Env)+2)
+	for k, v := range m.Config.Env {
+		env = append(env, k+"="+v)
+	}
+	if mounts := grantedValue(granted, PrivilegeMount); len(mounts) > 0 {
+		env = append(env, "WUKONGIM_PLUGIN_ALLOWED_MOUNTS="+strings.Join(mounts, ","))
+	}
+	if hosts := grantedValue(granted, PrivilegeNetwork); len(hosts) > 0 {
+		env = append(env, "WUKONGIM_PLUGIN_ALLOWED_HOSTS="+strings.Join(hosts, ","))
+	}
+	return env
+}
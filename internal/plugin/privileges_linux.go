@@ -0,0 +1,70 @@
+//go:build linux
+
+package plugin
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// applyResourceLimits 把 PrivilegeResources 里授予的内存限额套到cmd上。
+// 做法是用 prlimit(1) 包一层再exec真正的插件进程，这不是完整的seccomp/cgroup隔离，
+// 只是一个轻量的rlimit兜底，挡住明显失控的插件，真正的强隔离留给容器化部署。
+//
+// cpu 目前只是被 checkGranted 校验授权，这里不会读取也不会限制它：prlimit没有
+// 对应"CPU份额"的rlimit，真正的CPU配额需要cgroup，留给容器化部署去做。
+func applyResourceLimits(cmd *exec.Cmd, granted []Privilege) error {
+	values := grantedValue(granted, PrivilegeResources)
+
+	var memBytes uint64
+	for _, v := range values {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok {
+			continue
+		}
+		if k == "mem" {
+			limit, err := parseMemoryLimit(val)
+			if err != nil {
+				return fmt.Errorf("plugin: invalid memory limit %q: %w", val, err)
+			}
+			memBytes = limit
+		}
+	}
+
+	if memBytes == 0 {
+		return nil
+	}
+
+	args := append([]string{"--as=" + strconv.FormatUint(memBytes, 10), "--", cmd.Path}, cmd.Args[1:]...)
+	prlimitPath, err := exec.LookPath("prlimit")
+	if err != nil {
+		return fmt.Errorf("plugin: prlimit not available to enforce memory limit: %w", err)
+	}
+	cmd.Path = prlimitPath
+	cmd.Args = append([]string{prlimitPath}, args...)
+	return nil
+}
+
+// parseMemoryLimit 解析形如 "256m" "1g" 的内存限额，返回字节数
+func parseMemoryLimit(s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "g"):
+		multiplier = 1 << 30
+		s = strings.TrimSuffix(s, "g")
+	case strings.HasSuffix(s, "m"):
+		multiplier = 1 << 20
+		s = strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "k"):
+		multiplier = 1 << 10
+		s = strings.TrimSuffix(s, "k")
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package plugin
+
+import "os/exec"
+
+// applyResourceLimits 在非Linux平台上没有rlimit包装实现，这里只是占位，
+// 保证 startPluginApp 在其他平台上仍然能编译、运行（只是不强制资源限额）。
+func applyResourceLimits(cmd *exec.Cmd, granted []Privilege) error {
+	return nil
+}
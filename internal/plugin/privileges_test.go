@@ -0,0 +1,93 @@
+package plugin
+
+import "testing"
+
+func TestPrivilegesFromManifest(t *testing.T) {
+	m := &manifest{
+		Config: manifestConfig{
+			// Methods 是插件实现的hook方法（WuKongIM调用插件），不需要授权，
+			// 不应该出现在 privilegesFromManifest 的结果里——只有 RPCMethods
+			// （插件反过来调用WuKongIM）才是需要授权的权限。
+			Methods:      []string{"MessageWillSave"},
+			RPCMethods:   []string{"SendMessage"},
+			Mounts:       []string{"/data"},
+			NetworkHosts: []string{"api.example.com"},
+			Resources:    resourceLimits{CPU: "1", Memory: "256m"},
+		},
+	}
+
+	got := privilegesFromManifest(m)
+
+	want := map[string][]string{
+		PrivilegeNetwork:   {"api.example.com"},
+		PrivilegeMount:     {"/data"},
+		PrivilegeRPCMethod: {"SendMessage"},
+		PrivilegeResources: {"cpu=1", "mem=256m"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("privilegesFromManifest() returned %d privileges, want %d: %+v", len(got), len(want), got)
+	}
+	for _, p := range got {
+		wantValues, ok := want[p.Name]
+		if !ok {
+			t.Fatalf("unexpected privilege %q", p.Name)
+		}
+		if len(p.Value) != len(wantValues) {
+			t.Fatalf("privilege %q value = %v, want %v", p.Name, p.Value, wantValues)
+		}
+		for i, v := range p.Value {
+			if v != wantValues[i] {
+				t.Fatalf("privilege %q value = %v, want %v", p.Name, p.Value, wantValues)
+			}
+		}
+	}
+}
+
+func TestPrivilegesFromManifestEmpty(t *testing.T) {
+	got := privilegesFromManifest(&manifest{})
+	if len(got) != 0 {
+		t.Fatalf("privilegesFromManifest(empty) = %+v, want none", got)
+	}
+}
+
+func TestCheckGranted(t *testing.T) {
+	required := []Privilege{
+		{Name: PrivilegeNetwork, Value: []string{"api.example.com"}},
+		{Name: PrivilegeRPCMethod, Value: []string{"SendMessage"}},
+	}
+
+	t.Run("granted covers required", func(t *testing.T) {
+		granted := []Privilege{
+			{Name: PrivilegeNetwork, Value: []string{"api.example.com", "other.example.com"}},
+			{Name: PrivilegeRPCMethod, Value: []string{"SendMessage", "GetChannelInfo"}},
+		}
+		if err := checkGranted(required, granted); err != nil {
+			t.Fatalf("checkGranted() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing privilege entirely", func(t *testing.T) {
+		granted := []Privilege{
+			{Name: PrivilegeRPCMethod, Value: []string{"SendMessage"}},
+		}
+		if err := checkGranted(required, granted); err == nil {
+			t.Fatal("checkGranted() expected error for ungranted privilege, got nil")
+		}
+	})
+
+	t.Run("missing one value within a granted privilege", func(t *testing.T) {
+		granted := []Privilege{
+			{Name: PrivilegeNetwork, Value: []string{"other.example.com"}},
+			{Name: PrivilegeRPCMethod, Value: []string{"SendMessage"}},
+		}
+		if err := checkGranted(required, granted); err == nil {
+			t.Fatal("checkGranted() expected error for ungranted value, got nil")
+		}
+	})
+
+	t.Run("nothing required always passes", func(t *testing.T) {
+		if err := checkGranted(nil, nil); err != nil {
+			t.Fatalf("checkGranted(nil, nil) unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongIM/internal/types"
+	"github.com/WuKongIM/wkrpc"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const (
+	// registryDirName 插件注册目录，放在沙箱目录下，外部插件进程在此目录下
+	// 创建 `<name>-reg.sock` 完成两阶段握手注册（类似 kubelet 的设备插件注册方式）
+	registryDirName = "plugins_registry"
+	// regSockSuffix 注册socket的文件名后缀，用于和插件自身的服务socket区分
+	regSockSuffix = "-reg.sock"
+)
+
+// registrant 一个已完成握手的插件注册信息
+type registrant struct {
+	name        string // 插件名
+	version     string // 插件版本
+	methods     []types.PluginMethod
+	serviceAddr string // 插件对外提供服务的socket地址
+	regSockPath string // 注册socket路径，用于在文件被删除时定位注册记录
+	client      *wkrpc.Client
+
+	livenessMu     sync.Mutex
+	livenessFailed int // 连续存活探测失败次数
+}
+
+func (r *registrant) incFailure() int {
+	r.livenessMu.Lock()
+	defer r.livenessMu.Unlock()
+	r.livenessFailed++
+	return r.livenessFailed
+}
+
+func (r *registrant) resetFailures() {
+	r.livenessMu.Lock()
+	r.livenessFailed = 0
+	r.livenessMu.Unlock()
+}
+
+// registryDir 返回注册目录的绝对路径，不存在则创建
+func (s *Server) registryDir() (string, error) {
+	dir := path.Join(s.sandboxDir, registryDirName)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// startRegistry 启动插件注册监听
+//
+// 与 startPlugins 里"拉起本地可执行文件"的模式不同，这里采用插件主动注册的方式：
+// 插件进程（可以由容器、systemd 或其他非 WuKongIM 拉起的方式启动）在 registryDir 下
+// 创建自己的注册socket，server 监听到后拨号调用 GetInfo 完成握手，再调用
+// NotifyRegistrationStatus 告知插件是否注册成功。注册socket被删除时自动注销插件。
+func (s *Server) startRegistry() error {
+	dir, err := s.registryDir()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	// 处理启动时已经存在的注册socket（server重启场景）
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	for _, entry := range entries {
+		if isRegSock(entry.Name()) {
+			s.handleRegister(path.Join(dir, entry.Name()))
+		}
+	}
+
+	go s.watchRegistry(watcher)
+
+	return nil
+}
+
+func (s *Server) watchRegistry(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !isRegSock(path.Base(event.Name)) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				s.handleRegister(event.Name)
+			} else if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				s.handleDeregister(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.Error("registry watcher error", zap.Error(err))
+		}
+	}
+}
+
+func isRegSock(name string) bool {
+	return strings.HasSuffix(name, regSockSuffix)
+}
+
+// handleRegister 拨号插件注册socket并调用 GetInfo 完成握手
+func (s *Server) handleRegister(regSockPath string) {
+	client := wkrpc.NewClient(fmt.Sprintf("unix://%s", regSockPath))
+	if err := client.Start(); err != nil {
+		s.Error("dial plugin registration socket failed", zap.Error(err), zap.String("sock", regSockPath))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	info, err := s.rpc.GetInfo(ctx, client)
+	if err != nil {
+		s.Error("get plugin info failed", zap.Error(err), zap.String("sock", regSockPath))
+		_ = s.rpc.NotifyRegistrationStatus(context.Background(), client, false, err.Error())
+		client.Stop()
+		return
+	}
+
+	s.registryMu.Lock()
+	s.registrants[regSockPath] = &registrant{
+		name:        info.Name,
+		version:     info.Version,
+		methods:     info.Methods,
+		serviceAddr: info.ServiceAddr,
+		regSockPath: regSockPath,
+		client:      client,
+	}
+	s.registryMu.Unlock()
+
+	s.pluginManager.registerFromInfo(info)
+
+	if err := s.rpc.NotifyRegistrationStatus(context.Background(), client, true, ""); err != nil {
+		s.Warn("notify registration status failed", zap.Error(err), zap.String("plugin", info.Name))
+	}
+
+	s.Info("plugin registered", zap.String("plugin", info.Name), zap.String("version", info.Version), zap.String("addr", info.ServiceAddr))
+}
+
+// handleDeregister 注册socket被删除时自动注销插件
+func (s *Server) handleDeregister(regSockPath string) {
+	s.registryMu.Lock()
+	r, ok := s.registrants[regSockPath]
+	if ok {
+		delete(s.registrants, regSockPath)
+	}
+	s.registryMu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.pluginManager.unregister(r.name)
+	if r.client != nil {
+		r.client.Stop()
+	}
+	s.Info("plugin deregistered", zap.String("plugin", r.name))
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/WuKongIM/WuKongIM/internal/types"
+	"github.com/WuKongIM/wkrpc"
+)
+
+// rpc 封装 server 侧的RPC路由注册，以及 server 主动向插件发起的RPC调用
+type rpc struct {
+	s *Server
+}
+
+func newRpc(s *Server) *rpc {
+	return &rpc{s: s}
+}
+
+// routes 注册插件可以调用的RPC路由
+func (r *rpc) routes() {
+	// 当前不注册任何路由：rpcServer 上没有插件可以调用的WuKongIM方法
+}
+
+// pluginInfo 插件在 GetInfo 握手中上报的信息
+type pluginInfo struct {
+	Name        string               `json:"name"`
+	Version     string               `json:"version"`
+	Methods     []types.PluginMethod `json:"methods"`
+	ServiceAddr string               `json:"serviceAddr"` // 插件自身对外提供服务的socket地址
+}
+
+// GetInfo 拨通插件的注册socket后调用，获取插件名字、版本、支持的方法集合和服务地址
+func (r *rpc) GetInfo(ctx context.Context, client *wkrpc.Client) (*pluginInfo, error) {
+	var info pluginInfo
+	if err := client.RequestWithContext(ctx, "GetInfo", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Ping 通过给定的client向插件发起一次轻量存活探测，供 supervisor 周期性检测插件是否僵死；
+// checkLiveness 传入的是注册socket上的连接，而不是插件的服务socket
+func (r *rpc) Ping(ctx context.Context, client *wkrpc.Client) error {
+	return client.RequestWithContext(ctx, "Ping", nil, nil)
+}
+
+// NotifyRegistrationStatus 告知插件本次注册是否被server接受
+func (r *rpc) NotifyRegistrationStatus(ctx context.Context, client *wkrpc.Client, accepted bool, reason string) error {
+	req := struct {
+		Accepted bool   `json:"accepted"`
+		Reason   string `json:"reason,omitempty"`
+	}{Accepted: accepted, Reason: reason}
+	return client.RequestWithContext(ctx, "NotifyRegistrationStatus", req, nil)
+}
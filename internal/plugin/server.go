@@ -2,16 +2,16 @@ package plugin
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/WuKongIM/WuKongIM/internal/types"
-	"github.com/fsnotify/fsnotify"
 
 	"github.com/WuKongIM/WuKongIM/pkg/wklog"
 	"github.com/WuKongIM/wkrpc"
@@ -25,6 +25,13 @@ type Server struct {
 	wklog.Log
 	opts       *Options
 	sandboxDir string // 沙箱目录
+	store      *pluginStore
+	privileges *grantedPrivilegeStore
+
+	registryMu  sync.Mutex
+	registrants map[string]*registrant // 已通过握手注册的插件，key为注册socket路径
+
+	lifecycleEvents chan LifecycleEvent
 }
 
 func NewServer(opts *Options) *Server {
@@ -57,12 +64,22 @@ func NewServer(opts *Options) *Server {
 		return nil
 	}
 
+	// store落在沙箱目录下而不是opts.Dir，因为opts.Dir随后会被chmod为只读
+	store, err := newPluginStore(sandboxDir)
+	if err != nil {
+		panic(err)
+	}
+
 	s := &Server{
-		rpcServer:     rpcServer,
-		opts:          opts,
-		pluginManager: newPluginManager(),
-		Log:           wklog.NewWKLog("plugin.server"),
-		sandboxDir:    sandboxDir,
+		rpcServer:       rpcServer,
+		opts:            opts,
+		pluginManager:   newPluginManager(),
+		Log:             wklog.NewWKLog("plugin.server"),
+		sandboxDir:      sandboxDir,
+		store:           store,
+		privileges:      newGrantedPrivilegeStore(),
+		registrants:     make(map[string]*registrant),
+		lifecycleEvents: make(chan LifecycleEvent, 64),
 	}
 	s.rpc = newRpc(s)
 	return s
@@ -74,11 +91,20 @@ func (s *Server) Start() error {
 	}
 	s.rpc.routes()
 
+	// 监听插件注册目录，接受通过握手协议主动注册的插件（包括非本进程拉起的插件）
+	if err := s.startRegistry(); err != nil {
+		s.Error("start registry error", zap.Error(err))
+		return err
+	}
+
 	if err := s.startPlugins(); err != nil {
 		s.Error("start plugins error", zap.Error(err))
 		return err
 	}
 
+	// 对已注册插件做周期性存活探测，连续失败视为崩溃并触发重启
+	s.startLiveness()
+
 	return nil
 }
 
@@ -149,32 +175,19 @@ func getUnixSocket() (string, error) {
 	return fmt.Sprintf("unix://%s", socketPath), nil
 }
 
-// 启动插件执行文件
+// 启动插件
+//
+// 启动的插件来自store中已安装的引用（即经过 Install 校验摘要的制品），而不是
+// 直接扫描 opts.Dir 下任意文件 —— 后者会把随便丢进目录的二进制当作插件以server的
+// 全部权限执行。
 func (s *Server) startPlugins() error {
-	pluginDir := s.opts.Dir
-	// 获取插件目录下的所有文件
-	files, err := os.ReadDir(pluginDir)
-	if err != nil {
+	if err := s.startPluginsFromStore(); err != nil {
 		return err
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		// 启动插件
-		s.Info("Plugin start", zap.String("plugin", file.Name()))
-		err := s.startPluginApp(file.Name())
-		if err != nil {
-			s.Error("start plugin error", zap.Error(err))
-			continue
-		}
-	}
-
-	// 监听插件目录的插件变化
+	// 监听插件目录的插件变化（可执行文件更新/删除）
 	go func() {
-		err = s.watchPlugins()
+		err := s.watchPlugins()
 		if err != nil {
 			s.Error("watch plugins error", zap.Error(err))
 		}
@@ -183,86 +196,15 @@ func (s *Server) startPlugins() error {
 	return nil
 }
 
-// 监听插件目录的插件变化
-func (s *Server) watchPlugins() error {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	defer watcher.Close()
-
-	watcher.Add(s.opts.Dir) // 监听插件目录
-
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return nil
-			}
-			// 判断文件是否是目录
-			fileInfo, err := os.Stat(event.Name)
-			if err != nil {
-				if !os.IsNotExist(err) {
-					s.Error("stat file error", zap.Error(err))
-					continue
-				}
-			}
-			if fileInfo != nil && fileInfo.IsDir() {
-				continue
-			}
-
-			// 获取插件名字
-			pluginName := path.Base(event.Name)
-
-			if event.Has(fsnotify.Create) { // 新增插件
-
-				// 启动插件
-				s.Info("Plugin file created", zap.String("plugin", pluginName))
-				err = s.startPluginApp(pluginName)
-				if err != nil {
-					s.Error("start plugin error", zap.Error(err))
-				}
-
-			} else if event.Has(fsnotify.Write) { // 插件更新
-
-				// 重启插件
-				s.Info("Plugin file changed", zap.String("plugin", pluginName))
-				err = s.restartPlugin(pluginName)
-				if err != nil {
-					s.Error("restart plugin error", zap.Error(err))
-				}
-			} else if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) { // 插件删除
-				s.Info("Plugin file removed", zap.String("plugin", pluginName))
-				err = s.stopPluginApp(pluginName)
-				if err != nil {
-					s.Error("stop plugin error", zap.Error(err))
-				}
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return nil
-			}
-			s.Error("watcher error", zap.Error(err))
-		}
-	}
-
-}
-
 func (s *Server) stopPlugins() error {
-	pluginDir := s.opts.Dir
-	// 获取插件目录下的所有文件
-	files, err := os.ReadDir(pluginDir)
+	refs, err := s.store.listInstalled()
 	if err != nil {
 		return err
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
+	for _, r := range refs {
 		// 停止插件
-		err := s.stopPluginApp(file.Name())
+		err := s.stopPluginApp(r.Name)
 		if err != nil {
 			s.Error("stop plugin error", zap.Error(err))
 			continue
@@ -272,27 +214,82 @@ func (s *Server) stopPlugins() error {
 }
 
 // 启动插件程序
+//
+// 只应用 Install 时被授予的权限：manifest里声明了、但用户没有在 grantedPrivileges
+// 里授予的能力一律不生效，超出授权范围的插件直接拒绝启动，而不是像之前那样任何
+// 丢进目录的二进制都以server的全部权限执行。
 func (s *Server) startPluginApp(name string) error {
 
-	cmd := exec.Command("./" + name)
+	// 必须是经 Install 校验过摘要、登记过manifest的插件才允许启动：没有manifest
+	// 就没有声明权限可言，checkGranted无从谈起，如果这里再放行"随便丢进opts.Dir
+	// 的二进制"这条legacy路径，就等于chunk0-3引入的整套权限校验形同虚设。
+	m, err := s.installedManifest(name)
+	if err != nil {
+		s.Error("plugin has no installed manifest, refusing to start", zap.Error(err), zap.String("plugin", name))
+		return fmt.Errorf("plugin: %q is not installed, run Install first: %w", name, err)
+	}
+
+	granted := s.privileges.get(name)
+	if err := checkGranted(privilegesFromManifest(m), granted); err != nil {
+		s.Error("plugin requests more privileges than granted, refusing to start", zap.Error(err), zap.String("plugin", name))
+		return err
+	}
+
+	cmd := exec.Command(s.store.runPath(name))
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Dir = s.opts.Dir
-
-	// 允许相对路径运行
-	if errors.Is(cmd.Err, exec.ErrDot) {
-		cmd.Err = nil
+	cmd.Env = append(os.Environ(), s.pluginAppEnv(name, granted)...)
+	// 独立进程组，方便killProcessGroup (supervisor.go) 停止时一次性把整组信号发过去。
+	// 这必须是平台无关的：只在applyResourceLimits的Linux实现里设置的话，非Linux
+	// 平台上进程永远不会有自己的pgid，killProcessGroup里的 syscall.Kill(-pgid, ...)
+	// 就会打到server自己所在的进程组上。
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := applyResourceLimits(cmd, granted); err != nil {
+		s.Error("apply resource limits failed", zap.Error(err), zap.String("plugin", name))
+		return err
 	}
+
 	// start the process
-	err := cmd.Start()
-	if err != nil {
+	if err = cmd.Start(); err != nil {
 		s.Error("starting plugin process failed", zap.Error(err), zap.String("plugin", name))
 		return err
 	}
 
+	// 跟踪进程并在独立goroutine里等待其退出，取代之前"Start后就不再理会"的做法，
+	// 这样进程崩溃后才能被发现并按退避策略自动重启。
+	//
+	// 这里不伪造一个 pluginInstance 塞进 pluginManager.plugins/byName：本地拉起
+	// 的插件要在 Server.Plugins()/Plugin(no) 里可见、可被按ServiceAddr拨通，
+	// 必须和外部启动的插件走同一套 registerFromInfo 握手（见 registry.go），
+	// 否则会出现一个 addr 永远为空、实际拨不通的"幽灵"pluginInstance。
+	// 启动后是否握手、何时握手，由插件自己按规范决定。
+	st := newProcState(cmd)
+	s.pluginManager.setProcess(name, st)
+
+	s.emitEvent(name, "started", nil)
+	go s.superviseProcess(name, st)
+
 	return nil
 }
 
+// installedManifest 返回本地已安装的name(latest tag)对应的manifest，没有安装记录则返回error
+func (s *Server) installedManifest(name string) (*manifest, error) {
+	digest, err := s.store.getRef(name, "latest")
+	if err != nil {
+		return nil, err
+	}
+	return s.store.getManifest(digest)
+}
+
+func (s *Server) pluginAppEnv(name string, granted []Privilege) []string {
+	m, err := s.installedManifest(name)
+	if err != nil {
+		return nil
+	}
+	return pluginEnv(m, granted)
+}
+
 func (s *Server) restartPlugin(name string) error {
 	// 停止插件
 	err := s.stopPluginApp(name)
@@ -309,6 +306,9 @@ func (s *Server) restartPlugin(name string) error {
 }
 
 // 停止插件程序
+//
+// 先礼后兵：先把该名字下已登记的插件实例置为异常（pluginInstance.Stop 不发RPC），
+// 再SIGTERM，等待 opts.StopTimeout 后仍未退出就SIGKILL整个进程组。
 func (s *Server) stopPluginApp(name string) error {
 
 	// 通知插件停止
@@ -318,11 +318,14 @@ func (s *Server) stopPluginApp(name string) error {
 	for _, p := range plugins {
 		_ = p.Stop(timeoutCtx)
 	}
-	// pluginPath := path.Join(s.opts.Dir, name)
-	// cmd := exec.Command("pkill", "-f", pluginPath)
-	// err := cmd.Run()
-	// if err != nil {
-	// 	return err
-	// }
+
+	st := s.pluginManager.getProcess(name)
+	if st == nil {
+		return nil
+	}
+	st.manualStop.Store(true)
+	killProcessGroup(st, s.opts.StopTimeout)
+	s.pluginManager.deleteProcess(name)
+
 	return nil
 }
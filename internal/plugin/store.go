@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// pluginStore 管理以内容寻址方式存储的插件制品（OCI artifact）
+//
+// 磁盘布局：
+//
+//	<dir>/store/blobs/sha256/<digest>        不可变的blob（可执行文件层、manifest、config等）
+//	<dir>/store/plugins/<name>/<tag>          引用文件，内容为该名字/tag指向的manifest摘要
+//
+// 同一份内容（同一个blob）可以通过 Install 的 alias 参数安装成多个本地名字而不冲突，
+// 因为引用树按 name/tag 组织，真正的数据以 digest 为唯一标识存放在 blobs 下。
+type pluginStore struct {
+	dir string // 即 opts.Dir/plugindata/store
+}
+
+func newPluginStore(dir string) (*pluginStore, error) {
+	ps := &pluginStore{dir: path.Join(dir, "store")}
+	// putBlob/setRef写入前必须保证这两棵子目录已经存在，否则全新安装时第一次
+	// Pull()写manifest blob会因为store目录都还没创建而直接ENOENT失败
+	if err := os.MkdirAll(path.Join(ps.dir, "blobs", "sha256"), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(path.Join(ps.dir, "plugins"), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (ps *pluginStore) blobPath(digest string) string {
+	return path.Join(ps.dir, "blobs", "sha256", digest)
+}
+
+func (ps *pluginStore) refPath(name, tag string) string {
+	return path.Join(ps.dir, "plugins", name, tag)
+}
+
+// runPath 返回某个本地安装名对应的可执行文件落盘位置。
+//
+// blobs/sha256/<digest> 本身不可直接当成可执行文件来跑：它是按内容寻址命名的，
+// exec.Command需要一个按插件名命名、带执行权限的路径，所以Install会把验证过的
+// exec层blob复制一份到这里，startPluginApp只认这个目录。
+func (ps *pluginStore) runPath(name string) string {
+	return path.Join(ps.dir, "run", name)
+}
+
+// materializeExec 把digest对应的exec层blob复制一份到 runPath(name)，赋予可执行权限。
+// 复制而不是直接引用blob，是因为blob在blobs/sha256下是0555的不可变内容，
+// exec.Command按名字拉起时希望有一个独立、稳定命名的可执行文件路径。
+func (ps *pluginStore) materializeExec(name, digest string) error {
+	src, err := ps.openBlob(digest)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	runDir := path.Join(ps.dir, "run")
+	if err := os.MkdirAll(runDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(runDir, name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, ps.runPath(name))
+}
+
+// putBlob 将内容写入blob存储，返回其sha256摘要，并校验其是否与期望摘要一致（如果提供了的话）
+func (ps *pluginStore) putBlob(r io.Reader, wantDigest string) (string, error) {
+	tmp, err := os.CreateTemp(ps.dir, "blob-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	if wantDigest != "" && digest != wantDigest {
+		return "", fmt.Errorf("plugin: blob digest mismatch, want %s got %s", wantDigest, digest)
+	}
+
+	blobPath := ps.blobPath(digest)
+	if err := os.MkdirAll(path.Dir(blobPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPath, blobPath); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(blobPath, 0555); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+func (ps *pluginStore) openBlob(digest string) (*os.File, error) {
+	return os.Open(ps.blobPath(digest))
+}
+
+// manifest 描述一个插件制品：可执行文件层、运行所需的沙箱配置，以及可选签名
+type manifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Name          string `json:"name"`
+	Tag           string `json:"tag"`
+	// ExecDigest 可执行文件层的sha256摘要
+	ExecDigest string `json:"execDigest"`
+	// Config 插件运行所需的声明式配置
+	Config manifestConfig `json:"config"`
+	// Signature 可选的制品签名，用于校验发布者身份
+	Signature string `json:"signature,omitempty"`
+}
+
+// manifestConfig 声明插件运行所需的能力和环境，配合 privileges.go 中的授权流程使用
+type manifestConfig struct {
+	// Methods 插件声明自己实现了的hook方法集合（WuKongIM调用插件），对应 types.PluginMethod，
+	// 纯能力声明，不需要用户授权——决定的是插件"能不能被派发某个hook"，不是安全边界。
+	Methods []string `json:"methods"`
+	// RPCMethods 插件运行时需要反过来调用的WuKongIM RPC方法集合（插件调用WuKongIM），
+	// 需要用户在 Install 时显式授权，由 checkGranted 校验，是真正的访问控制。
+	// 不要和 Methods 混用：两者方向相反，字段刻意分开。
+	RPCMethods []string `json:"rpcMethods,omitempty"`
+	// Mounts 插件沙箱所需的额外挂载路径（sandboxDir之外）
+	Mounts []string `json:"mounts,omitempty"`
+	// Env 插件运行所需的环境变量
+	Env map[string]string `json:"env,omitempty"`
+	// NetworkHosts 插件运行所需访问的出站host
+	NetworkHosts []string `json:"networkHosts,omitempty"`
+	// Resources 插件运行所需的资源限额
+	Resources resourceLimits `json:"resources,omitempty"`
+}
+
+// resourceLimits 插件声明所需的CPU/内存限额
+type resourceLimits struct {
+	CPU    string `json:"cpu,omitempty"`    // 如 "1", "0.5"
+	Memory string `json:"memory,omitempty"` // 如 "256m"
+}
+
+// putManifest 将manifest序列化后作为blob写入，返回其摘要
+func (ps *pluginStore) putManifest(m *manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return ps.putBlob(bytes.NewReader(data), "")
+}
+
+func (ps *pluginStore) getManifest(digest string) (*manifest, error) {
+	f, err := ps.openBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m manifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// setRef 将 name/tag 指向给定的manifest摘要，支持同一内容安装为多个本地别名
+func (ps *pluginStore) setRef(name, tag, manifestDigest string) error {
+	refPath := ps.refPath(name, tag)
+	if err := os.MkdirAll(path.Dir(refPath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(refPath, []byte(manifestDigest), 0644)
+}
+
+func (ps *pluginStore) getRef(name, tag string) (string, error) {
+	data, err := os.ReadFile(ps.refPath(name, tag))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (ps *pluginStore) removeRef(name, tag string) error {
+	err := os.Remove(ps.refPath(name, tag))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// installedRef 描述一个已安装的插件引用
+type installedRef struct {
+	Name           string
+	Tag            string
+	ManifestDigest string
+}
+
+// listInstalled 枚举所有已安装的 name/tag 引用
+func (ps *pluginStore) listInstalled() ([]installedRef, error) {
+	namesDir := path.Join(ps.dir, "plugins")
+	nameEntries, err := os.ReadDir(namesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var refs []installedRef
+	for _, nameEntry := range nameEntries {
+		if !nameEntry.IsDir() {
+			continue
+		}
+		tagEntries, err := os.ReadDir(path.Join(namesDir, nameEntry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, tagEntry := range tagEntries {
+			if tagEntry.IsDir() {
+				continue
+			}
+			digest, err := ps.getRef(nameEntry.Name(), tagEntry.Name())
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, installedRef{
+				Name:           nameEntry.Name(),
+				Tag:            tagEntry.Name(),
+				ManifestDigest: digest,
+			})
+		}
+	}
+	return refs, nil
+}
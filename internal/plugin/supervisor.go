@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LifecycleEvent 插件生命周期事件，admin API据此向外展示插件的启动/退出/重启情况
+type LifecycleEvent struct {
+	Name   string
+	Status string // "started"、"exited"、"restarting"、"crashed"、"stopped"
+	Err    error
+}
+
+// Events 返回插件生命周期事件的只读channel，供admin API订阅
+func (s *Server) Events() <-chan LifecycleEvent {
+	return s.lifecycleEvents
+}
+
+func (s *Server) emitEvent(name, status string, err error) {
+	select {
+	case s.lifecycleEvents <- LifecycleEvent{Name: name, Status: status, Err: err}:
+	default:
+		// 没人消费事件时不要阻塞supervisor本身
+		s.Warn("lifecycle event dropped, channel full", zap.String("plugin", name), zap.String("status", status))
+	}
+}
+
+// superviseProcess 在独立goroutine里等待插件进程退出，并按退避策略决定是否自动重启。
+// 取代原先"cmd.Start()后就不再理会"的做法。
+func (s *Server) superviseProcess(name string, st *procState) {
+	waitErr := st.cmd.Wait()
+	close(st.done)
+
+	if st.manualStop.Load() {
+		s.emitEvent(name, "stopped", nil)
+		return
+	}
+
+	s.Warn("plugin process exited", zap.String("plugin", name), zap.Error(waitErr))
+	s.emitEvent(name, "exited", waitErr)
+
+	if !s.shouldRestart(st) {
+		s.Error("plugin exceeded max restart retries, giving up", zap.String("plugin", name), zap.Int("maxRetries", s.opts.RestartMaxRetries))
+		s.emitEvent(name, "crashed", waitErr)
+		// 放弃重启后进程已经不在了，但registerFromInfo登记的
+		// pluginInstance还留着状态Normal——Status()必须跟着反映成异常，
+		// 否则Plugins()还会一直选中一个其实已经死透的插件。
+		s.pluginManager.markAbnormal(name)
+		return
+	}
+
+	backoff := restartBackoff(st.retries)
+	s.Info("restarting plugin after backoff", zap.String("plugin", name), zap.Duration("backoff", backoff), zap.Int("attempt", st.retries))
+	s.emitEvent(name, "restarting", nil)
+	time.Sleep(backoff)
+
+	if err := s.startPluginApp(name); err != nil {
+		s.Error("restart plugin failed", zap.Error(err), zap.String("plugin", name))
+	}
+}
+
+// shouldRestart 判断是否还允许自动重启：在 RestartResetWindow 时间窗口内超过
+// RestartMaxRetries 次就放弃，避免crash-loop把日志和CPU都打满
+func (s *Server) shouldRestart(st *procState) bool {
+	now := time.Now()
+	if st.windowStart.IsZero() || now.Sub(st.windowStart) > s.opts.RestartResetWindow {
+		st.retries = 0
+		st.windowStart = now
+	}
+	st.retries++
+	return st.retries <= s.opts.RestartMaxRetries
+}
+
+func restartBackoff(retries int) time.Duration {
+	backoff := time.Duration(1<<uint(retries)) * time.Second
+	const max = 30 * time.Second
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// killProcessGroup 先发SIGTERM给插件礼貌退出，等待 opts.StopTimeout 后仍未退出则SIGKILL整个进程组
+func killProcessGroup(st *procState, timeout time.Duration) {
+	if st.cmd.Process == nil {
+		return
+	}
+	pgid := st.cmd.Process.Pid
+
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+
+	select {
+	case <-st.done:
+	case <-time.After(timeout):
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		<-st.done
+	}
+}
+
+// startLiveness 启动对已通过握手注册的插件的周期性存活探测。连续失败达到
+// LivenessMaxFailures 次即视为插件崩溃，走和进程退出一样的重启路径。
+func (s *Server) startLiveness() {
+	ticker := time.NewTicker(s.opts.LivenessInterval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			s.checkLiveness()
+		}
+	}()
+}
+
+func (s *Server) checkLiveness() {
+	s.registryMu.Lock()
+	regs := make([]*registrant, 0, len(s.registrants))
+	for _, r := range s.registrants {
+		regs = append(regs, r)
+	}
+	s.registryMu.Unlock()
+
+	for _, r := range regs {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := s.rpc.Ping(ctx, r.client)
+		cancel()
+
+		if err == nil {
+			r.resetFailures()
+			continue
+		}
+
+		failures := r.incFailure()
+		s.Warn("plugin liveness ping failed", zap.String("plugin", r.name), zap.Int("failures", failures), zap.Error(err))
+		if failures < s.opts.LivenessMaxFailures {
+			continue
+		}
+
+		s.Error("plugin failed liveness checks, treating as crashed", zap.String("plugin", r.name))
+		s.emitEvent(r.name, "crashed", err)
+
+		if st := s.pluginManager.getProcess(r.name); st != nil {
+			// 这个插件是WuKongIM本地拉起的（同时还做了握手注册），我们手上握着
+			// 它的进程句柄，可以走和进程退出一样的路径：杀掉失联的进程组、
+			// 重置失败计数，再重新拉起，而不是像之前那样只会注销、永远不恢复。
+			s.Warn("killing and restarting unresponsive local plugin", zap.String("plugin", r.name))
+			// 先标记manualStop，这样superviseProcess看到进程退出后只会发"stopped"事件、
+			// 不会自己再按退避策略抢着重启一次，避免和下面这里的重启撞车。
+			st.manualStop.Store(true)
+			killProcessGroup(st, s.opts.StopTimeout)
+			s.pluginManager.deleteProcess(r.name)
+			r.resetFailures()
+			if err := s.startPluginApp(r.name); err != nil {
+				s.Error("restart unresponsive plugin failed", zap.Error(err), zap.String("plugin", r.name))
+			}
+			continue
+		}
+
+		// 纯粹通过握手协议注册、并非由WuKongIM本地拉起的插件（例如由容器、systemd
+		// 或其他进程管理器启动），这里没有进程句柄可以杀、也没有命令可以重新拉起它——
+		// 对这类插件，崩溃恢复本就超出了本进程的职责范围，只能先注销，
+		// 等它自己的进程管理方式把它重新拉起、重新完成一次握手后再恢复注册。
+		s.handleDeregister(r.regSockPath)
+	}
+}
@@ -0,0 +1,234 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// debounceWindow 一次文件改动之后，等待多久没有新的Write/Create事件才认为它写完整了
+const debounceWindow = 500 * time.Millisecond
+
+// watchPlugins 监听插件目录（及其子目录）的插件变化
+//
+// 相比逐个事件立即触发重启，这里把同一文件在debounceWindow窗口内的多次
+// Write/Create事件合并成一次处理，避免大文件复制过程中触发多次重启、
+// 甚至把还没写完整的半截文件当成插件拉起来；处理时再校验文件确实可执行、
+// 且sha256和当前运行实例不同才重启。原子替换（写临时文件再rename到目标名）
+// 在inotify层面表现为对目标路径的一次Create，天然会被当成一次更新处理，
+// 不会被拆成Remove+Create两次而产生竞态。
+//
+// 另外递归监听子目录，这样 opts.Dir/<name>/<name> 这种插件独占一个目录的
+// 布局也能被发现，为bundle/manifest的store布局做准备。
+func (s *Server) watchPlugins() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := addWatchRecursive(watcher, s.opts.Dir); err != nil {
+		return err
+	}
+
+	d := newDebouncer(debounceWindow, s.handlePluginPathChange)
+	defer d.stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			s.handleWatchEvent(watcher, d, event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			s.Error("watcher error", zap.Error(err))
+		}
+	}
+}
+
+func (s *Server) handleWatchEvent(watcher *fsnotify.Watcher, d *debouncer, event fsnotify.Event) {
+	info, statErr := os.Stat(event.Name)
+	isDir := statErr == nil && info.IsDir()
+
+	// 新增的子目录也要递归监听，覆盖插件独占一个目录（<name>/<name>）的布局
+	if isDir && event.Has(fsnotify.Create) {
+		if err := addWatchRecursive(watcher, event.Name); err != nil {
+			s.Error("watch new plugin dir failed", zap.Error(err), zap.String("dir", event.Name))
+		}
+		return
+	}
+	if isDir {
+		return
+	}
+
+	if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		d.trigger(event.Name)
+	}
+}
+
+// handlePluginPathChange 在debounce窗口过后针对某个路径的最终状态做一次性处理
+func (s *Server) handlePluginPathChange(filePath string) {
+	pluginName := pluginNameForPath(s.opts.Dir, filePath)
+	if pluginName == "" {
+		return
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.Info("plugin file removed", zap.String("plugin", pluginName))
+			if err := s.stopPluginApp(pluginName); err != nil {
+				s.Error("stop plugin error", zap.Error(err), zap.String("plugin", pluginName))
+			}
+			return
+		}
+		s.Error("stat plugin file error", zap.Error(err), zap.String("plugin", pluginName))
+		return
+	}
+
+	if info.IsDir() {
+		return
+	}
+
+	if !isExecutable(info) {
+		s.Warn("plugin file is not executable yet, skip", zap.String("plugin", pluginName), zap.String("path", filePath))
+		return
+	}
+
+	// 如果这个名字是通过 Install 安装的store引用，重启与否交给 restartIfDigestChanged
+	// 按manifest摘要判断，而不是这里再算一遍原始文件的sha256。
+	if _, err := s.store.getRef(pluginName, "latest"); err == nil {
+		if err := s.restartIfDigestChanged(pluginName, "latest"); err != nil {
+			s.Error("restart plugin error", zap.Error(err), zap.String("plugin", pluginName))
+		}
+		return
+	}
+
+	digest, err := sha256File(filePath)
+	if err != nil {
+		s.Error("hash plugin file failed", zap.Error(err), zap.String("plugin", pluginName))
+		return
+	}
+
+	if s.pluginManager.runningDigest(pluginName) == digest {
+		// 内容和当前运行实例一致，忽略（例如同一份内容的touch，或debounce期间的重复事件）
+		return
+	}
+
+	if s.pluginManager.getProcess(pluginName) == nil {
+		s.Info("plugin file created", zap.String("plugin", pluginName))
+		if err := s.startPluginApp(pluginName); err != nil {
+			s.Error("start plugin error", zap.Error(err), zap.String("plugin", pluginName))
+			return
+		}
+	} else {
+		s.Info("plugin file changed", zap.String("plugin", pluginName))
+		if err := s.restartPlugin(pluginName); err != nil {
+			s.Error("restart plugin error", zap.Error(err), zap.String("plugin", pluginName))
+			return
+		}
+	}
+	s.pluginManager.setRunningDigest(pluginName, digest)
+}
+
+// pluginNameForPath 把一个文件路径映射为插件名。
+// 直接放在opts.Dir下的文件，插件名就是文件名；放在opts.Dir/<name>/<name>这种
+// 独占目录布局下的文件，插件名取子目录名，且要求文件名和目录名一致，避免把
+// 插件自己写的配置文件、日志文件之类的误判成插件本体。
+func pluginNameForPath(rootDir, filePath string) string {
+	dir := filepath.Dir(filePath)
+	base := filepath.Base(filePath)
+
+	if dir == filepath.Clean(rootDir) {
+		return base
+	}
+
+	if filepath.Base(dir) == base {
+		return base
+	}
+	return ""
+}
+
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode()&0111 != 0
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func addWatchRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(p)
+		}
+		return nil
+	})
+}
+
+// debouncer 把同一个key在quiet窗口内的多次触发合并成窗口结束后的一次回调
+type debouncer struct {
+	window time.Duration
+	fn     func(key string)
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newDebouncer(window time.Duration, fn func(key string)) *debouncer {
+	return &debouncer{
+		window: window,
+		fn:     fn,
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+func (d *debouncer) trigger(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t, ok := d.timers[key]; ok {
+		t.Reset(d.window)
+		return
+	}
+	d.timers[key] = time.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		delete(d.timers, key)
+		d.mu.Unlock()
+		d.fn(key)
+	})
+}
+
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, t := range d.timers {
+		t.Stop()
+	}
+	d.timers = make(map[string]*time.Timer)
+}
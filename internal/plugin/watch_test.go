@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPluginNameForPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		rootDir  string
+		filePath string
+		want     string
+	}{
+		{
+			name:     "file directly under root",
+			rootDir:  "/plugins",
+			filePath: "/plugins/xxim-webhook",
+			want:     "xxim-webhook",
+		},
+		{
+			name:     "plugin in its own subdirectory",
+			rootDir:  "/plugins",
+			filePath: "/plugins/xxim-webhook/xxim-webhook",
+			want:     "xxim-webhook",
+		},
+		{
+			name:     "unrelated file inside a plugin's own subdirectory",
+			rootDir:  "/plugins",
+			filePath: "/plugins/xxim-webhook/config.yaml",
+			want:     "",
+		},
+		{
+			name:     "root itself has a trailing slash",
+			rootDir:  "/plugins/",
+			filePath: "/plugins/xxim-webhook",
+			want:     "xxim-webhook",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pluginNameForPath(tt.rootDir, tt.filePath); got != tt.want {
+				t.Fatalf("pluginNameForPath(%q, %q) = %q, want %q", tt.rootDir, tt.filePath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebouncerCoalescesTrigger(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+
+	d := newDebouncer(20*time.Millisecond, func(key string) {
+		mu.Lock()
+		calls[key]++
+		mu.Unlock()
+	})
+	defer d.stop()
+
+	// 同一个key在窗口内连续触发多次，应该只回调一次
+	d.trigger("a")
+	d.trigger("a")
+	d.trigger("a")
+	// 不同key互不影响
+	d.trigger("b")
+
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["a"] != 1 {
+		t.Fatalf("calls[a] = %d, want 1", calls["a"])
+	}
+	if calls["b"] != 1 {
+		t.Fatalf("calls[b] = %d, want 1", calls["b"])
+	}
+}
+
+func TestDebouncerStopCancelsPendingCallbacks(t *testing.T) {
+	var mu sync.Mutex
+	fired := false
+
+	d := newDebouncer(20*time.Millisecond, func(key string) {
+		mu.Lock()
+		fired = true
+		mu.Unlock()
+	})
+	d.trigger("a")
+	d.stop()
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fired {
+		t.Fatal("debouncer fired after stop()")
+	}
+}
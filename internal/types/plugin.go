@@ -0,0 +1,31 @@
+package types
+
+// PluginMethod 插件声明自己实现了的可被WuKongIM调用的RPC方法
+type PluginMethod string
+
+const (
+	// PluginMethodMessageWillSave 消息保存前
+	PluginMethodMessageWillSave PluginMethod = "MessageWillSave"
+	// PluginMethodMessageDidSave 消息保存后
+	PluginMethodMessageDidSave PluginMethod = "MessageDidSave"
+	// PluginMethodConnect 连接建立
+	PluginMethodConnect PluginMethod = "Connect"
+	// PluginMethodDisconnect 连接断开
+	PluginMethodDisconnect PluginMethod = "Disconnect"
+)
+
+// PluginStatus 插件状态
+type PluginStatus int
+
+const (
+	// PluginStatusNormal 插件运行正常，可被 Plugins() 选中
+	PluginStatusNormal PluginStatus = iota
+	// PluginStatusAbnormal 插件异常（已停止、崩溃未恢复等），不会被 Plugins() 选中
+	PluginStatusAbnormal
+)
+
+// Plugin 对外暴露的插件视图，供业务侧挑选可用插件和查询状态
+type Plugin interface {
+	// Status 返回插件当前状态
+	Status() PluginStatus
+}